@@ -0,0 +1,262 @@
+package httpcache
+
+import (
+  "container/list"
+  "context"
+  "crypto/sha1"
+  "encoding/hex"
+  "encoding/json"
+  "net/http"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "sync"
+  "sync/atomic"
+  "time"
+)
+
+// Fetcher performs the actual upstream request for a cache miss, under a
+// context owned by the Cache (see Cache.fetchTimeout) rather than any one
+// caller's request context, so a caller giving up doesn't cancel the fetch
+// for other callers coalesced onto it.
+type Fetcher func(ctx context.Context, url string) (interface{}, *http.Response, error)
+
+type entry struct {
+  key        string
+  value      interface{}
+  statusCode int
+  expiresAt  time.Time
+}
+
+// call represents an in-flight or completed fetch, used to coalesce
+// concurrent lookups for the same URL.
+type call struct {
+  wg    sync.WaitGroup
+  value interface{}
+  resp  *http.Response
+  err   error
+}
+
+// Cache is a small in-memory LRU with an optional on-disk copy of its
+// entries, used to avoid hitting upstream .well-known endpoints on every
+// request. Entries
+// are evicted least-recently-used first: both a lookup hit and an update
+// move an entry to the front of order.
+type Cache struct {
+  ttl          time.Duration
+  maxEntries   int
+  dir          string
+  fetchTimeout time.Duration
+
+  mu      sync.Mutex
+  entries map[string]*list.Element
+  order   *list.List
+
+  flight sync.Mutex
+  calls  map[string]*call
+
+  hits   uint64
+  misses uint64
+}
+
+// New creates a Cache with the given default TTL and entry cap. If dir is
+// non-empty, successful responses are additionally persisted as JSON files
+// under dir so the cache survives restarts. fetchTimeout bounds each
+// Fetcher call; it is applied against context.Background(), not any
+// caller's request context, so coalesced callers share a fetch that no
+// single one of them can cancel early.
+func New(ttl time.Duration, maxEntries int, dir string, fetchTimeout time.Duration) *Cache {
+  if dir != "" {
+    _ = os.MkdirAll(dir, 0o755)
+  }
+  return &Cache{
+    ttl:          ttl,
+    maxEntries:   maxEntries,
+    dir:          dir,
+    fetchTimeout: fetchTimeout,
+    entries:      make(map[string]*list.Element),
+    order:        list.New(),
+    calls:        make(map[string]*call),
+  }
+}
+
+// Get returns the cached value for url if present and unexpired, otherwise
+// calls fetch, caches the result on success and returns it. Concurrent calls
+// for the same url are coalesced into a single fetch, run under its own
+// fetchTimeout-bounded context so one caller's cancellation can't fail the
+// fetch for the others coalesced onto it.
+func (c *Cache) Get(url string, fetch Fetcher) (interface{}, *http.Response, error) {
+  if v, statusCode, ok := c.lookup(url); ok {
+    atomic.AddUint64(&c.hits, 1)
+    return v, &http.Response{StatusCode: statusCode}, nil
+  }
+  atomic.AddUint64(&c.misses, 1)
+
+  c.flight.Lock()
+  if inFlight, ok := c.calls[url]; ok {
+    c.flight.Unlock()
+    inFlight.wg.Wait()
+    return inFlight.value, inFlight.resp, inFlight.err
+  }
+  cl := &call{}
+  cl.wg.Add(1)
+  c.calls[url] = cl
+  c.flight.Unlock()
+
+  ctx, cancel := context.WithTimeout(context.Background(), c.fetchTimeout)
+  cl.value, cl.resp, cl.err = fetch(ctx, url)
+  cancel()
+  cl.wg.Done()
+
+  c.flight.Lock()
+  delete(c.calls, url)
+  c.flight.Unlock()
+
+  if cl.err == nil && cl.resp != nil && cl.resp.StatusCode < 300 {
+    c.store(url, cl.value, cl.resp.StatusCode, ttlFromResponse(cl.resp, c.ttl))
+  }
+  return cl.value, cl.resp, cl.err
+}
+
+// Stats returns the cumulative hit and miss counts since the cache was
+// created.
+func (c *Cache) Stats() (hits, misses uint64) {
+  return atomic.LoadUint64(&c.hits), atomic.LoadUint64(&c.misses)
+}
+
+func (c *Cache) lookup(url string) (interface{}, int, bool) {
+  c.mu.Lock()
+  el, ok := c.entries[url]
+  if ok {
+    e := el.Value.(*entry)
+    if time.Now().Before(e.expiresAt) {
+      c.order.MoveToFront(el)
+      c.mu.Unlock()
+      return e.value, e.statusCode, true
+    }
+    c.removeLocked(el)
+  }
+  c.mu.Unlock()
+
+  if c.dir == "" {
+    return nil, 0, false
+  }
+  de, ok := c.readDisk(url)
+  if !ok {
+    return nil, 0, false
+  }
+  if time.Now().After(de.ExpiresAt) {
+    c.removeDisk(url)
+    return nil, 0, false
+  }
+  c.store(url, de.Value, de.StatusCode, time.Until(de.ExpiresAt))
+  return de.Value, de.StatusCode, true
+}
+
+func (c *Cache) store(url string, value interface{}, statusCode int, ttl time.Duration) {
+  c.mu.Lock()
+  e := &entry{key: url, value: value, statusCode: statusCode, expiresAt: time.Now().Add(ttl)}
+  if el, exists := c.entries[url]; exists {
+    el.Value = e
+    c.order.MoveToFront(el)
+  } else {
+    c.entries[url] = c.order.PushFront(e)
+  }
+  var evicted []string
+  for c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+    oldest := c.order.Back()
+    oldestEntry := oldest.Value.(*entry)
+    c.removeLocked(oldest)
+    evicted = append(evicted, oldestEntry.key)
+  }
+  c.mu.Unlock()
+
+  for _, key := range evicted {
+    c.removeDisk(key)
+  }
+  if c.dir != "" {
+    c.writeDisk(url, diskEntry{Value: value, StatusCode: statusCode, ExpiresAt: time.Now().Add(ttl)})
+  }
+}
+
+// removeLocked removes el from both order and entries. Callers must hold mu.
+func (c *Cache) removeLocked(el *list.Element) {
+  e := el.Value.(*entry)
+  c.order.Remove(el)
+  delete(c.entries, e.key)
+}
+
+type diskEntry struct {
+  Value      interface{} `json:"value"`
+  StatusCode int         `json:"status_code"`
+  ExpiresAt  time.Time   `json:"expires_at"`
+}
+
+func (c *Cache) diskPath(url string) string {
+  sum := sha1.Sum([]byte(url))
+  return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *Cache) writeDisk(url string, de diskEntry) {
+  f, err := os.Create(c.diskPath(url))
+  if err != nil {
+    return
+  }
+  defer f.Close()
+  _ = json.NewEncoder(f).Encode(de)
+}
+
+func (c *Cache) readDisk(url string) (diskEntry, bool) {
+  f, err := os.Open(c.diskPath(url))
+  if err != nil {
+    return diskEntry{}, false
+  }
+  defer f.Close()
+  var de diskEntry
+  if err := json.NewDecoder(f).Decode(&de); err != nil {
+    return diskEntry{}, false
+  }
+  return de, true
+}
+
+// removeDisk deletes the on-disk entry for url, if any, keeping CACHE_DIR
+// bounded to the same maxEntries as the in-memory LRU and pruning entries
+// found stale on read.
+func (c *Cache) removeDisk(url string) {
+  _ = os.Remove(c.diskPath(url))
+}
+
+// ttlFromResponse honors Cache-Control max-age or Expires headers when
+// present, falling back to def.
+func ttlFromResponse(resp *http.Response, def time.Duration) time.Duration {
+  if resp == nil {
+    return def
+  }
+  if expires := resp.Header.Get("Expires"); expires != "" {
+    if t, err := http.ParseTime(expires); err == nil {
+      if d := time.Until(t); d > 0 {
+        return d
+      }
+    }
+  }
+  if cc := resp.Header.Get("Cache-Control"); cc != "" {
+    if d, ok := parseMaxAge(cc); ok {
+      return d
+    }
+  }
+  return def
+}
+
+func parseMaxAge(cacheControl string) (time.Duration, bool) {
+  const prefix = "max-age="
+  for _, part := range strings.Split(cacheControl, ",") {
+    part = strings.TrimSpace(part)
+    if strings.HasPrefix(part, prefix) {
+      if seconds, err := strconv.Atoi(strings.TrimPrefix(part, prefix)); err == nil && seconds >= 0 {
+        return time.Duration(seconds) * time.Second, true
+      }
+    }
+  }
+  return 0, false
+}
@@ -0,0 +1,240 @@
+package httpcache
+
+import (
+  "context"
+  "net/http"
+  "os"
+  "sync"
+  "sync/atomic"
+  "testing"
+  "time"
+)
+
+func fetchValue(v interface{}, statusCode int) Fetcher {
+  return func(ctx context.Context, url string) (interface{}, *http.Response, error) {
+    return v, &http.Response{StatusCode: statusCode, Header: http.Header{}}, nil
+  }
+}
+
+func TestCacheEvictionOrder(t *testing.T) {
+  c := New(time.Minute, 2, "", time.Second)
+
+  if _, _, err := c.Get("a", fetchValue("a", 200)); err != nil {
+    t.Fatalf("Get(a): %v", err)
+  }
+  if _, _, err := c.Get("b", fetchValue("b", 200)); err != nil {
+    t.Fatalf("Get(b): %v", err)
+  }
+
+  // Touch "a" so it becomes the most recently used, leaving "b" as the
+  // eviction candidate.
+  if _, _, err := c.Get("a", fetchValue("stale", 200)); err != nil {
+    t.Fatalf("Get(a) again: %v", err)
+  }
+
+  // Adding a third entry should evict "b", the least recently used.
+  if _, _, err := c.Get("c", fetchValue("c", 200)); err != nil {
+    t.Fatalf("Get(c): %v", err)
+  }
+
+  var calls int32
+  countingFetch := func(v interface{}) Fetcher {
+    return func(ctx context.Context, url string) (interface{}, *http.Response, error) {
+      atomic.AddInt32(&calls, 1)
+      return v, &http.Response{StatusCode: 200, Header: http.Header{}}, nil
+    }
+  }
+
+  if v, _, _ := c.Get("a", countingFetch("refetched-a")); v != "a" {
+    t.Errorf("expected cached hit for a, got %v", v)
+  }
+  if v, _, _ := c.Get("b", countingFetch("refetched-b")); v != "refetched-b" {
+    t.Errorf("expected b to have been evicted and refetched, got %v", v)
+  }
+  if atomic.LoadInt32(&calls) != 1 {
+    t.Errorf("expected exactly 1 fetch (for evicted b), got %d", calls)
+  }
+}
+
+func TestCacheTTLExpiry(t *testing.T) {
+  c := New(10*time.Millisecond, 0, "", time.Second)
+
+  if _, _, err := c.Get("a", fetchValue("first", 200)); err != nil {
+    t.Fatalf("Get(a): %v", err)
+  }
+  time.Sleep(20 * time.Millisecond)
+
+  var calls int32
+  v, _, err := c.Get("a", func(ctx context.Context, url string) (interface{}, *http.Response, error) {
+    atomic.AddInt32(&calls, 1)
+    return "second", &http.Response{StatusCode: 200, Header: http.Header{}}, nil
+  })
+  if err != nil {
+    t.Fatalf("Get(a) after expiry: %v", err)
+  }
+  if v != "second" || calls != 1 {
+    t.Errorf("expected expired entry to be refetched, got value=%v calls=%d", v, calls)
+  }
+}
+
+func TestCacheTTLFromHeader(t *testing.T) {
+  t.Run("Expires header extends ttl beyond default", func(t *testing.T) {
+    c := New(time.Millisecond, 0, "", time.Second)
+    resp := &http.Response{StatusCode: 200, Header: http.Header{}}
+    resp.Header.Set("Expires", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+    if _, _, err := c.Get("a", func(ctx context.Context, url string) (interface{}, *http.Response, error) {
+      return "v", resp, nil
+    }); err != nil {
+      t.Fatalf("Get(a): %v", err)
+    }
+    time.Sleep(5 * time.Millisecond)
+    if _, _, ok := c.lookup("a"); !ok {
+      t.Error("expected entry with future Expires header to still be cached")
+    }
+  })
+
+  t.Run("Cache-Control max-age extends ttl beyond default", func(t *testing.T) {
+    c := New(time.Millisecond, 0, "", time.Second)
+    resp := &http.Response{StatusCode: 200, Header: http.Header{}}
+    resp.Header.Set("Cache-Control", "max-age=3600")
+    if _, _, err := c.Get("a", func(ctx context.Context, url string) (interface{}, *http.Response, error) {
+      return "v", resp, nil
+    }); err != nil {
+      t.Fatalf("Get(a): %v", err)
+    }
+    time.Sleep(5 * time.Millisecond)
+    if _, _, ok := c.lookup("a"); !ok {
+      t.Error("expected entry with max-age header to still be cached")
+    }
+  })
+
+  t.Run("past-dated Expires falls back to default ttl", func(t *testing.T) {
+    resp := &http.Response{StatusCode: 200, Header: http.Header{}}
+    resp.Header.Set("Expires", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+    ttl := ttlFromResponse(resp, 42*time.Second)
+    if ttl != 42*time.Second {
+      t.Errorf("expected fallback to default ttl for past Expires, got %s", ttl)
+    }
+  })
+
+  t.Run("negative max-age falls back to default ttl", func(t *testing.T) {
+    resp := &http.Response{StatusCode: 200, Header: http.Header{}}
+    resp.Header.Set("Cache-Control", "max-age=-5")
+    ttl := ttlFromResponse(resp, 42*time.Second)
+    if ttl != 42*time.Second {
+      t.Errorf("expected fallback to default ttl for negative max-age, got %s", ttl)
+    }
+  })
+}
+
+func TestCacheDiskRoundTripAndPrune(t *testing.T) {
+  dir := t.TempDir()
+  c := New(10*time.Millisecond, 0, dir, time.Second)
+
+  if _, _, err := c.Get("a", fetchValue("on-disk", 200)); err != nil {
+    t.Fatalf("Get(a): %v", err)
+  }
+  if _, ok := c.readDisk("a"); !ok {
+    t.Fatal("expected entry to be persisted to disk")
+  }
+
+  // A fresh Cache instance pointed at the same dir should recover the value
+  // from disk without calling fetch.
+  c2 := New(time.Minute, 0, dir, time.Second)
+  var calls int32
+  v, _, err := c2.Get("a", func(ctx context.Context, url string) (interface{}, *http.Response, error) {
+    atomic.AddInt32(&calls, 1)
+    return "should-not-be-used", &http.Response{StatusCode: 200, Header: http.Header{}}, nil
+  })
+  if err != nil {
+    t.Fatalf("Get(a) on fresh cache: %v", err)
+  }
+  if v != "on-disk" || calls != 0 {
+    t.Errorf("expected disk round-trip to hit without fetching, got value=%v calls=%d", v, calls)
+  }
+
+  // Once the entry goes stale, a read must prune the file from disk.
+  time.Sleep(20 * time.Millisecond)
+  c3 := New(time.Minute, 0, dir, time.Second)
+  if _, _, ok := c3.lookup("a"); ok {
+    t.Error("expected stale disk entry to not be returned")
+  }
+  if _, err := os.Stat(c3.diskPath("a")); !os.IsNotExist(err) {
+    t.Error("expected stale disk entry to be pruned from disk")
+  }
+}
+
+func TestCacheDiskPrunedOnEviction(t *testing.T) {
+  dir := t.TempDir()
+  c := New(time.Minute, 1, dir, time.Second)
+
+  if _, _, err := c.Get("a", fetchValue("a", 200)); err != nil {
+    t.Fatalf("Get(a): %v", err)
+  }
+  if _, err := os.Stat(c.diskPath("a")); err != nil {
+    t.Fatalf("expected a's disk file to exist: %v", err)
+  }
+
+  // maxEntries is 1, so adding "b" evicts "a" from memory and should also
+  // remove its disk file.
+  if _, _, err := c.Get("b", fetchValue("b", 200)); err != nil {
+    t.Fatalf("Get(b): %v", err)
+  }
+  if _, err := os.Stat(c.diskPath("a")); !os.IsNotExist(err) {
+    t.Error("expected a's disk file to be removed after eviction")
+  }
+}
+
+func TestCacheConcurrentCoalescing(t *testing.T) {
+  c := New(time.Minute, 0, "", time.Second)
+
+  var calls int32
+  started := make(chan struct{})
+  release := make(chan struct{})
+  fetch := func(ctx context.Context, url string) (interface{}, *http.Response, error) {
+    if atomic.AddInt32(&calls, 1) == 1 {
+      close(started)
+      <-release
+    }
+    return "v", &http.Response{StatusCode: 200, Header: http.Header{}}, nil
+  }
+
+  const n = 10
+  var wg sync.WaitGroup
+  results := make([]interface{}, n)
+  for i := 0; i < n; i++ {
+    wg.Add(1)
+    go func(i int) {
+      defer wg.Done()
+      <-started
+      v, _, err := c.Get("shared", fetch)
+      if err != nil {
+        t.Errorf("Get: %v", err)
+        return
+      }
+      results[i] = v
+    }(i)
+  }
+
+  // Kick off the first call so the others have something to coalesce onto.
+  wg.Add(1)
+  go func() {
+    defer wg.Done()
+    if _, _, err := c.Get("shared", fetch); err != nil {
+      t.Errorf("Get: %v", err)
+    }
+  }()
+
+  time.Sleep(20 * time.Millisecond)
+  close(release)
+  wg.Wait()
+
+  if atomic.LoadInt32(&calls) != 1 {
+    t.Errorf("expected concurrent callers to coalesce into 1 fetch, got %d", calls)
+  }
+  for i, v := range results {
+    if v != "v" {
+      t.Errorf("result %d: expected coalesced value %q, got %v", i, "v", v)
+    }
+  }
+}
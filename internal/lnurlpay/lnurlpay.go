@@ -0,0 +1,142 @@
+// Package lnurlpay resolves a Lightning Address's lnurlp metadata all the
+// way to a payable BOLT11 invoice, implementing the payRequest half of LUD-06
+// (https://github.com/lnurl/luds/blob/luds/06.md) with optional NIP-57 zap
+// support.
+package lnurlpay
+
+import (
+  "context"
+  "crypto/sha256"
+  "encoding/json"
+  "fmt"
+  "net/http"
+  "net/url"
+  "strconv"
+
+  "github.com/btcsuite/btcd/chaincfg"
+  "github.com/lightningnetwork/lnd/zpay32"
+)
+
+// Metadata is the payRequest document served at .well-known/lnurlp/<user>.
+type Metadata struct {
+  Callback       string `json:"callback"`
+  MaxSendable    int64  `json:"maxSendable"`
+  MinSendable    int64  `json:"minSendable"`
+  Metadata       string `json:"metadata"`
+  CommentAllowed int64  `json:"commentAllowed"`
+  Tag            string `json:"tag"`
+  AllowsNostr    bool   `json:"allowsNostr"`
+  NostrPubkey    string `json:"nostrPubkey"`
+}
+
+// ParseMetadata converts the generic JSON already decoded by GetJSON into a
+// typed Metadata.
+func ParseMetadata(raw interface{}) (*Metadata, error) {
+  b, err := json.Marshal(raw)
+  if err != nil {
+    return nil, fmt.Errorf("invalid lnurlp metadata: %v", err)
+  }
+  m := &Metadata{}
+  if err := json.Unmarshal(b, m); err != nil {
+    return nil, fmt.Errorf("invalid lnurlp metadata: %v", err)
+  }
+  if m.Callback == "" {
+    return nil, fmt.Errorf("lnurlp metadata missing callback")
+  }
+  return m, nil
+}
+
+// Request describes an LNURL-pay invoice request against a resolved
+// Metadata.
+type Request struct {
+  AmountMsat int64
+  Comment    string
+  NostrEvent string
+}
+
+// Invoice is the callback response, reused verbatim for NIP-57 zap
+// invoices.
+type Invoice struct {
+  PR            string        `json:"pr"`
+  SuccessAction interface{}   `json:"successAction"`
+  Routes        []interface{} `json:"routes"`
+}
+
+// Resolve validates req against meta's constraints, invokes the callback and
+// verifies the returned invoice's description hash before returning it: it
+// must match meta's metadata string, or, for a zap, the forwarded nostr
+// event.
+func Resolve(ctx context.Context, client *http.Client, meta *Metadata, req Request) (*Invoice, error) {
+  if req.AmountMsat < meta.MinSendable || (meta.MaxSendable > 0 && req.AmountMsat > meta.MaxSendable) {
+    return nil, fmt.Errorf("amount %d msat outside allowed range [%d, %d]", req.AmountMsat, meta.MinSendable, meta.MaxSendable)
+  }
+  if req.Comment != "" && int64(len(req.Comment)) > meta.CommentAllowed {
+    return nil, fmt.Errorf("comment exceeds commentAllowed (%d)", meta.CommentAllowed)
+  }
+  if req.NostrEvent != "" && !meta.AllowsNostr {
+    return nil, fmt.Errorf("lnurlp metadata does not allow nostr zaps")
+  }
+
+  callbackUrl, err := url.Parse(meta.Callback)
+  if err != nil {
+    return nil, fmt.Errorf("invalid callback url: %v", err)
+  }
+  q := callbackUrl.Query()
+  q.Set("amount", strconv.FormatInt(req.AmountMsat, 10))
+  if req.Comment != "" {
+    q.Set("comment", req.Comment)
+  }
+  if req.NostrEvent != "" {
+    q.Set("nostr", req.NostrEvent)
+  }
+  callbackUrl.RawQuery = q.Encode()
+
+  httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, callbackUrl.String(), nil)
+  if err != nil {
+    return nil, fmt.Errorf("invalid callback request: %v", err)
+  }
+  resp, err := client.Do(httpReq)
+  if err != nil {
+    return nil, fmt.Errorf("callback request failed: %v", err)
+  }
+  defer resp.Body.Close()
+  if resp.StatusCode > 300 {
+    return nil, fmt.Errorf("callback returned status %d", resp.StatusCode)
+  }
+
+  inv := &Invoice{}
+  if err := json.NewDecoder(resp.Body).Decode(inv); err != nil {
+    return nil, fmt.Errorf("invalid callback response: %v", err)
+  }
+  if inv.PR == "" {
+    return nil, fmt.Errorf("callback response missing invoice")
+  }
+  // Per LUD-06 the description hash commits to the metadata string, but per
+  // NIP-57 a zap invoice instead commits to the serialized zap request event.
+  expectedHashPreimage := meta.Metadata
+  if req.NostrEvent != "" {
+    expectedHashPreimage = req.NostrEvent
+  }
+  if err := verifyDescriptionHash(inv.PR, expectedHashPreimage); err != nil {
+    return nil, err
+  }
+  return inv, nil
+}
+
+// verifyDescriptionHash decodes the BOLT11 invoice pr and checks its 'h' tag
+// matches the sha256 of preimage, as required by LUD-06 (metadata string) or
+// NIP-57 (serialized zap request event) depending on the caller.
+func verifyDescriptionHash(pr string, preimage string) error {
+  decoded, err := zpay32.Decode(pr, &chaincfg.MainNetParams)
+  if err != nil {
+    return fmt.Errorf("invalid invoice: %v", err)
+  }
+  if decoded.DescriptionHash == nil {
+    return fmt.Errorf("invoice missing description hash")
+  }
+  expected := sha256.Sum256([]byte(preimage))
+  if *decoded.DescriptionHash != expected {
+    return fmt.Errorf("invoice description hash does not match expected preimage")
+  }
+  return nil
+}
@@ -0,0 +1,88 @@
+package lnurlpay
+
+import (
+  "crypto/sha256"
+  "testing"
+  "time"
+
+  "github.com/btcsuite/btcd/btcec/v2"
+  "github.com/btcsuite/btcd/btcec/v2/ecdsa"
+  "github.com/btcsuite/btcd/chaincfg"
+  "github.com/btcsuite/btcd/chaincfg/chainhash"
+  "github.com/lightningnetwork/lnd/zpay32"
+)
+
+// signedInvoice builds and signs a minimal, fully valid BOLT11 invoice on
+// mainnet, for use as a test fixture.
+func signedInvoice(t *testing.T, opts ...func(*zpay32.Invoice)) string {
+  t.Helper()
+
+  privKey, err := btcec.NewPrivateKey()
+  if err != nil {
+    t.Fatalf("generating private key: %v", err)
+  }
+  signer := zpay32.MessageSigner{
+    SignCompact: func(msg []byte) ([]byte, error) {
+      return ecdsa.SignCompact(privKey, chainhash.HashB(msg), true), nil
+    },
+  }
+
+  var paymentHash [32]byte
+  copy(paymentHash[:], sha256.New().Sum(nil))
+
+  inv, err := zpay32.NewInvoice(&chaincfg.MainNetParams, paymentHash, time.Now(), opts...)
+  if err != nil {
+    t.Fatalf("building invoice: %v", err)
+  }
+  pr, err := inv.Encode(signer)
+  if err != nil {
+    t.Fatalf("encoding invoice: %v", err)
+  }
+  return pr
+}
+
+func TestVerifyDescriptionHash(t *testing.T) {
+  const metadata = `[["text/plain","pay me"]]`
+  const nostrEvent = `{"id":"abc","kind":9734,"content":""}`
+
+  t.Run("real invoice hashed against metadata passes (LUD-06)", func(t *testing.T) {
+    pr := signedInvoice(t, zpay32.DescriptionHash(sha256.Sum256([]byte(metadata))))
+    if err := verifyDescriptionHash(pr, metadata); err != nil {
+      t.Errorf("expected metadata hash to verify, got: %v", err)
+    }
+  })
+
+  t.Run("zap invoice hashed against nostr event passes (NIP-57)", func(t *testing.T) {
+    pr := signedInvoice(t, zpay32.DescriptionHash(sha256.Sum256([]byte(nostrEvent))))
+    if err := verifyDescriptionHash(pr, nostrEvent); err != nil {
+      t.Errorf("expected nostr event hash to verify, got: %v", err)
+    }
+  })
+
+  t.Run("zap invoice does not also match the metadata string", func(t *testing.T) {
+    pr := signedInvoice(t, zpay32.DescriptionHash(sha256.Sum256([]byte(nostrEvent))))
+    if err := verifyDescriptionHash(pr, metadata); err == nil {
+      t.Error("expected a zap invoice's hash to not match the original metadata string")
+    }
+  })
+
+  t.Run("mismatched hash is rejected", func(t *testing.T) {
+    pr := signedInvoice(t, zpay32.DescriptionHash(sha256.Sum256([]byte(metadata))))
+    if err := verifyDescriptionHash(pr, "something else entirely"); err == nil {
+      t.Error("expected a mismatched preimage to be rejected")
+    }
+  })
+
+  t.Run("invoice with plain description instead of a hash is rejected", func(t *testing.T) {
+    pr := signedInvoice(t, zpay32.Description("plain description, no hash"))
+    if err := verifyDescriptionHash(pr, metadata); err == nil {
+      t.Error("expected an invoice without a description hash to be rejected")
+    }
+  })
+
+  t.Run("malformed invoice is rejected", func(t *testing.T) {
+    if err := verifyDescriptionHash("not-a-valid-invoice", metadata); err == nil {
+      t.Error("expected a malformed invoice string to be rejected")
+    }
+  })
+}
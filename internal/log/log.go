@@ -0,0 +1,106 @@
+// Package log provides a per-request ring buffer of log records that can be
+// flushed into Sentry as breadcrumbs when a request ultimately fails, so an
+// issue arrives with the full trace of upstream calls that led up to it.
+package log
+
+import (
+  "context"
+  "fmt"
+  "sync"
+  "time"
+
+  "github.com/getsentry/sentry-go"
+  "github.com/labstack/echo/v4"
+)
+
+// Record is a single structured log entry captured during the lifetime of
+// one request.
+type Record struct {
+  Time    time.Time
+  Level   string
+  Message string
+  Data    map[string]interface{}
+}
+
+// Logger buffers the last maxRecords log records for a single request and
+// can flush them as Sentry breadcrumbs on error.
+type Logger struct {
+  mu      sync.Mutex
+  records []Record
+  max     int
+}
+
+const defaultMaxRecords = 20
+
+// New creates a Logger that keeps at most maxRecords entries, discarding the
+// oldest once full. A maxRecords <= 0 uses the package default.
+func New(maxRecords int) *Logger {
+  if maxRecords <= 0 {
+    maxRecords = defaultMaxRecords
+  }
+  return &Logger{max: maxRecords}
+}
+
+// Add appends a structured log record to the buffer.
+func (l *Logger) Add(level, message string, data map[string]interface{}) {
+  l.mu.Lock()
+  defer l.mu.Unlock()
+  l.records = append(l.records, Record{Time: time.Now(), Level: level, Message: message, Data: data})
+  if len(l.records) > l.max {
+    l.records = l.records[len(l.records)-l.max:]
+  }
+}
+
+// Errorf buffers a formatted "error" level record.
+func (l *Logger) Errorf(format string, args ...interface{}) {
+  l.Add("error", fmt.Sprintf(format, args...), nil)
+}
+
+// Infof buffers a formatted "info" level record.
+func (l *Logger) Infof(format string, args ...interface{}) {
+  l.Add("info", fmt.Sprintf(format, args...), nil)
+}
+
+// FlushToHub adds every buffered record to hub as a breadcrumb, in order, so
+// a subsequently captured exception carries the full trace that led to it.
+func (l *Logger) FlushToHub(hub *sentry.Hub) {
+  l.mu.Lock()
+  defer l.mu.Unlock()
+  for _, r := range l.records {
+    hub.AddBreadcrumb(&sentry.Breadcrumb{
+      Category:  "request",
+      Level:     sentry.Level(r.Level),
+      Message:   r.Message,
+      Data:      r.Data,
+      Timestamp: r.Time,
+    }, nil)
+  }
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying l, retrievable via FromContext.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+  return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the Logger installed by Middleware, or a fresh
+// throwaway Logger if none was installed.
+func FromContext(ctx context.Context) *Logger {
+  if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+    return l
+  }
+  return New(0)
+}
+
+// Middleware installs a fresh Logger into the request context so any code
+// path can buffer log entries without knowing about Sentry directly.
+func Middleware() echo.MiddlewareFunc {
+  return func(next echo.HandlerFunc) echo.HandlerFunc {
+    return func(c echo.Context) error {
+      ctx := NewContext(c.Request().Context(), New(0))
+      c.SetRequest(c.Request().WithContext(ctx))
+      return next(c)
+    }
+  }
+}
@@ -11,28 +11,49 @@ import (
   "time"
   "net/http"
   "strings"
+  "strconv"
+  "sync"
   "encoding/json"
   "github.com/getsentry/sentry-go"
   sentryecho "github.com/getsentry/sentry-go/echo"
   "github.com/joho/godotenv"
   "github.com/kelseyhightower/envconfig"
+  "github.com/getAlby/lightning-address-details-proxy/internal/httpcache"
+  reqlog "github.com/getAlby/lightning-address-details-proxy/internal/log"
+  "github.com/getAlby/lightning-address-details-proxy/internal/lnurlpay"
+  "golang.org/x/sync/errgroup"
 )
 
 type Config struct {
   SentryDSN             string `envconfig:"SENTRY_DSN"`
   LogFilePath           string `envconfig:"LOG_FILE_PATH"`
   Port                  int    `envconfig:"PORT" default:"3000"`
+  CacheTTL              time.Duration `envconfig:"CACHE_TTL" default:"5m"`
+  CacheMaxEntries       int    `envconfig:"CACHE_MAX_ENTRIES" default:"1000"`
+  CacheDir              string `envconfig:"CACHE_DIR"`
+  UpstreamTimeout       time.Duration `envconfig:"UPSTREAM_TIMEOUT" default:"5s"`
+  BatchMaxSize          int    `envconfig:"BATCH_MAX_SIZE" default:"50"`
+  BatchMaxConcurrency   int    `envconfig:"BATCH_MAX_CONCURRENCY" default:"10"`
+  BatchTimeout          time.Duration `envconfig:"BATCH_TIMEOUT" default:"20s"`
 }
 
 type LNResponse struct {
     Lnurlp interface{} `json:"lnurlp"`
     Keysend interface{} `json:"keysend"`
+    Error string `json:"error,omitempty"`
 }
 
 
-func GetJSON(url string) (interface{}, *http.Response, error) {
-  response, err := http.Get(url)
-  if err != nil || response.StatusCode > 300  {
+func GetJSON(ctx context.Context, client *http.Client, url string) (interface{}, *http.Response, error) {
+  req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+  if err != nil {
+    return nil, nil, fmt.Errorf("Invalid request: %s - %v", url, err)
+  }
+  response, err := client.Do(req)
+  if err != nil {
+    return nil, response, fmt.Errorf("No details: %s - %v", url, err)
+  } else if response.StatusCode > 300 {
+    response.Body.Close()
     return nil, response, fmt.Errorf("No details: %s - %v", url, err)
   } else {
     defer response.Body.Close()
@@ -46,6 +67,96 @@ func GetJSON(url string) (interface{}, *http.Response, error) {
   }
 }
 
+// timedFetch calls fetch, buffering a structured record of the URL, elapsed
+// time, status code and request ID into logger so it can be replayed as
+// Sentry breadcrumbs if the request ultimately fails.
+func timedFetch(logger *reqlog.Logger, requestID string, url string, fetch func(string) (interface{}, *http.Response, error)) (interface{}, *http.Response, error) {
+  start := time.Now()
+  value, response, err := fetch(url)
+  data := map[string]interface{}{
+    "url":        url,
+    "elapsed_ms": time.Since(start).Milliseconds(),
+    "request_id": requestID,
+  }
+  if response != nil {
+    data["status_code"] = response.StatusCode
+  }
+  if err != nil {
+    data["error"] = err.Error()
+    logger.Add("error", "upstream fetch failed", data)
+  } else {
+    logger.Add("info", "upstream fetch succeeded", data)
+  }
+  return value, response, err
+}
+
+// fetchLNAddressDetails resolves a single lightning address to an LNResponse,
+// fetching the lnurlp and keysend documents concurrently through cache. An
+// invalid address, or both fetches failing, is reported in the returned
+// LNResponse's Error field rather than as a Go error, so callers such as the
+// batch endpoint can collect partial results across many addresses; when
+// only one fetch fails, its field is left nil and Error stays empty.
+func fetchLNAddressDetails(cache *httpcache.Cache, httpClient *http.Client, logger *reqlog.Logger, requestID string, ln string) *LNResponse {
+  responseBody := &LNResponse{}
+
+  lnurlpUrl, keysendUrl, err := ToUrl(ln)
+  if err != nil {
+    responseBody.Error = err.Error()
+    return responseBody
+  }
+
+  fetch := func(url string) (interface{}, *http.Response, error) {
+    return cache.Get(url, func(ctx context.Context, url string) (interface{}, *http.Response, error) {
+      return GetJSON(ctx, httpClient, url)
+    })
+  }
+
+  var (
+    lnurlp, keysend                 interface{}
+    lnurlpResponse, keysendResponse *http.Response
+    lnurlpErr, keysendErr           error
+  )
+  var g errgroup.Group
+  g.Go(func() error {
+    lnurlp, lnurlpResponse, lnurlpErr = timedFetch(logger, requestID, lnurlpUrl, fetch)
+    return nil
+  })
+  g.Go(func() error {
+    keysend, keysendResponse, keysendErr = timedFetch(logger, requestID, keysendUrl, fetch)
+    return nil
+  })
+  g.Wait()
+
+  if lnurlpErr != nil {
+    logger.Errorf("%v", lnurlpErr)
+  } else {
+    responseBody.Lnurlp = lnurlp
+  }
+  if keysendErr != nil {
+    logger.Errorf("%v", keysendErr)
+  } else {
+    responseBody.Keysend = keysend
+  }
+
+  if lnurlpResponse == nil && keysendResponse == nil {
+    responseBody.Error = fmt.Sprintf("no details for %s", ln)
+  } else if lnurlpResponse != nil && keysendResponse != nil && lnurlpResponse.StatusCode > 300 && keysendResponse.StatusCode > 300 {
+    responseBody.Error = fmt.Sprintf("upstream failure for %s", ln)
+  }
+  return responseBody
+}
+
+// captureWithBreadcrumbs flushes the request's buffered log records into the
+// current Sentry hub as breadcrumbs before capturing err as an exception.
+func captureWithBreadcrumbs(c echo.Context, logger *reqlog.Logger, err error) {
+  hub := sentry.GetHubFromContext(c.Request().Context())
+  if hub == nil {
+    return
+  }
+  logger.FlushToHub(hub)
+  hub.CaptureException(err)
+}
+
 func ToUrl(identifier string) (string, string, error) {
   parts := strings.Split(identifier, "@")
   if len(parts) != 2 {
@@ -71,12 +182,20 @@ func main() {
     log.Fatalf("Error loading environment variables: %v", err)
   }
 
+  upstreamTimeout := c.UpstreamTimeout
+  cache := httpcache.New(c.CacheTTL, c.CacheMaxEntries, c.CacheDir, upstreamTimeout)
+  httpClient := &http.Client{}
+  batchMaxSize := c.BatchMaxSize
+  batchMaxConcurrency := c.BatchMaxConcurrency
+  batchTimeout := c.BatchTimeout
+
   e := echo.New()
   e.HideBanner = true
   e.Use(middleware.Logger())
   e.Use(middleware.Recover())
   e.Use(middleware.RequestID())
   e.Use(middleware.CORS())
+  e.Use(reqlog.Middleware())
 
   // Setup exception tracking with Sentry if configured
   if c.SentryDSN != "" {
@@ -92,6 +211,8 @@ func main() {
 
   e.GET("/lightning-address-details", func(c echo.Context) error {
     responseBody := &LNResponse{}
+    logger := reqlog.FromContext(c.Request().Context())
+    requestID := c.Response().Header().Get(echo.HeaderXRequestID)
 
     ln := c.QueryParam("ln")
     lnurlpUrl, keysendUrl, err := ToUrl(ln)
@@ -99,26 +220,47 @@ func main() {
       return c.JSON(http.StatusBadRequest, &responseBody)
     }
 
-    lnurlp, lnurlpResponse, err := GetJSON(lnurlpUrl)
-    if err != nil {
-      e.Logger.Errorf("%v", err)
+    fetch := func(url string) (interface{}, *http.Response, error) {
+      return cache.Get(url, func(ctx context.Context, url string) (interface{}, *http.Response, error) {
+        return GetJSON(ctx, httpClient, url)
+      })
+    }
+
+    var (
+      lnurlp, keysend                interface{}
+      lnurlpResponse, keysendResponse *http.Response
+      lnurlpErr, keysendErr           error
+    )
+    var g errgroup.Group
+    g.Go(func() error {
+      lnurlp, lnurlpResponse, lnurlpErr = timedFetch(logger, requestID, lnurlpUrl, fetch)
+      return nil
+    })
+    g.Go(func() error {
+      keysend, keysendResponse, keysendErr = timedFetch(logger, requestID, keysendUrl, fetch)
+      return nil
+    })
+    g.Wait()
+
+    if lnurlpErr != nil {
+      e.Logger.Errorf("%v", lnurlpErr)
     } else {
       responseBody.Lnurlp = lnurlp
     }
-
-    keysend, keysendResponse, err := GetJSON(keysendUrl)
-    if err != nil {
-      e.Logger.Errorf("%v", err)
+    if keysendErr != nil {
+      e.Logger.Errorf("%v", keysendErr)
     } else {
       responseBody.Keysend = keysend
     }
 
     // if both requests resulted in errors return a bad request. something must be wrong with the ln address
     if lnurlpResponse == nil && keysendResponse == nil {
+      captureWithBreadcrumbs(c, logger, fmt.Errorf("no details for %s: %v / %v", ln, lnurlpErr, keysendErr))
       return c.JSON(http.StatusBadRequest, &responseBody)
     }
     // if both response have no success
     if lnurlpResponse != nil && keysendResponse != nil && lnurlpResponse.StatusCode > 300 && keysendResponse.StatusCode > 300 {
+      captureWithBreadcrumbs(c, logger, fmt.Errorf("upstream failure for %s: lnurlp=%d keysend=%d", ln, lnurlpResponse.StatusCode, keysendResponse.StatusCode))
       return c.JSONPretty(lnurlpResponse.StatusCode, &responseBody, "  ")
     }
 
@@ -126,6 +268,125 @@ func main() {
     return c.JSONPretty(http.StatusOK, &responseBody, "  ")
   })
 
+  e.POST("/lightning-address-details/batch", func(c echo.Context) error {
+    var body struct {
+      Addresses []string `json:"addresses"`
+    }
+    if err := c.Bind(&body); err != nil || len(body.Addresses) == 0 {
+      return c.JSON(http.StatusBadRequest, map[string]string{"error": "addresses must be a non-empty array"})
+    }
+    if len(body.Addresses) > batchMaxSize {
+      return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("addresses exceeds the maximum batch size of %d", batchMaxSize)})
+    }
+
+    // A distinct, longer-lived deadline for the whole batch: upstreamTimeout
+    // bounds a single fetch, but up to batchMaxSize addresses fan out across
+    // only batchMaxConcurrency workers, so several sequential waves of
+    // fetches may be needed to drain the batch. Individual fetches run under
+    // the cache's own fetchTimeout rather than this context, so a batch
+    // timing out here returns whatever's done so far instead of cancelling
+    // fetches shared with other callers.
+    ctx, cancel := context.WithTimeout(c.Request().Context(), batchTimeout)
+    defer cancel()
+    logger := reqlog.FromContext(c.Request().Context())
+    requestID := c.Response().Header().Get(echo.HeaderXRequestID)
+
+    results := make(map[string]*LNResponse, len(body.Addresses))
+    var mu sync.Mutex
+    sem := make(chan struct{}, batchMaxConcurrency)
+    var wg sync.WaitGroup
+
+    for _, ln := range body.Addresses {
+      mu.Lock()
+      _, seen := results[ln]
+      if !seen {
+        results[ln] = &LNResponse{}
+      }
+      mu.Unlock()
+      if seen {
+        continue
+      }
+
+      ln := ln
+      select {
+      case sem <- struct{}{}:
+      case <-ctx.Done():
+        continue
+      }
+      wg.Add(1)
+      go func() {
+        defer wg.Done()
+        defer func() { <-sem }()
+        responseBody := fetchLNAddressDetails(cache, httpClient, logger, requestID, ln)
+        mu.Lock()
+        results[ln] = responseBody
+        mu.Unlock()
+      }()
+    }
+
+    done := make(chan struct{})
+    go func() {
+      wg.Wait()
+      close(done)
+    }()
+    select {
+    case <-done:
+    case <-ctx.Done():
+      logger.Errorf("batch timed out after %s with some addresses unresolved", batchTimeout)
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+    return c.JSONPretty(http.StatusOK, results, "  ")
+  })
+
+  e.POST("/lightning-address-invoice", func(c echo.Context) error {
+    ln := c.QueryParam("ln")
+    lnurlpUrl, _, err := ToUrl(ln)
+    if err != nil {
+      return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+    }
+
+    amountMsat, err := strconv.ParseInt(c.QueryParam("amount"), 10, 64)
+    if err != nil {
+      return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid or missing amount"})
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request().Context(), upstreamTimeout)
+    defer cancel()
+
+    raw, _, err := cache.Get(lnurlpUrl, func(fetchCtx context.Context, url string) (interface{}, *http.Response, error) {
+      return GetJSON(fetchCtx, httpClient, url)
+    })
+    if err != nil {
+      return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+    }
+
+    meta, err := lnurlpay.ParseMetadata(raw)
+    if err != nil {
+      return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+    }
+
+    invoice, err := lnurlpay.Resolve(ctx, httpClient, meta, lnurlpay.Request{
+      AmountMsat: amountMsat,
+      Comment:    c.QueryParam("comment"),
+      NostrEvent: c.QueryParam("nostr"),
+    })
+    if err != nil {
+      return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+    }
+
+    return c.JSONPretty(http.StatusOK, invoice, "  ")
+  })
+
+  e.GET("/metrics", func(c echo.Context) error {
+    hits, misses := cache.Stats()
+    return c.JSON(http.StatusOK, map[string]uint64{
+      "cache_hits":   hits,
+      "cache_misses": misses,
+    })
+  })
+
   // Start server
   go func() {
     if err := e.Start(fmt.Sprintf(":%v", c.Port)); err != nil && err != http.ErrServerClosed {